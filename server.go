@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -23,22 +24,36 @@ type Server struct {
 	activeWorkers    sync.WaitGroup
 }
 
-func New(dataPath string) *Server {
-	registry := whois.Registry{dataPath}
-	return &Server{registry, time.Now(), false, 0, sync.WaitGroup{}}
+func New(dataPath string, queryTimeout time.Duration, inverseAttrs []string) (*Server, error) {
+	registry, err := whois.NewRegistry(dataPath, queryTimeout, inverseAttrs)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{registry, time.Now(), false, 0, sync.WaitGroup{}}, nil
 }
 
-func (s *Server) Run(listener *net.TCPListener) {
+// deadlineListener is implemented by *net.TCPListener and *net.UnixListener.
+// Run type-asserts for it so Accept can be interrupted periodically to
+// notice Shutdown regardless of which transport is listening.
+type deadlineListener interface {
+	net.Listener
+	SetDeadline(t time.Time) error
+}
+
+func (s *Server) Run(listener net.Listener) {
 	atomic.StoreInt32(&s.stopListening, 0)
 	s.activeWorkers.Add(1)
 	defer s.activeWorkers.Done()
 	defer listener.Close()
+	dl, hasDeadline := listener.(deadlineListener)
 	for atomic.LoadInt32(&s.stopListening) != 1 {
-		if e := listener.SetDeadline(time.Now().Add(time.Second)); e != nil {
-			fmt.Fprintf(os.Stderr, "Error setting deadline: %v\n", e)
-			continue
+		if hasDeadline {
+			if e := dl.SetDeadline(time.Now().Add(time.Second)); e != nil {
+				fmt.Fprintf(os.Stderr, "Error setting deadline: %v\n", e)
+				continue
+			}
 		}
-		conn, err := listener.AcceptTCP()
+		conn, err := listener.Accept()
 		if err != nil {
 			if err, ok := err.(net.Error); ok && err.Timeout() {
 				continue
@@ -59,7 +74,7 @@ func (s *Server) Shutdown() {
 	s.activeWorkers.Wait()
 }
 
-func (s *Server) handleConn(conn *net.TCPConn) {
+func (s *Server) handleConn(conn net.Conn) {
 	defer func() {
 		conn.Close()
 		s.activeWorkers.Done()
@@ -73,6 +88,9 @@ type options struct {
 	Address       string
 	Registry      string
 	SocketTimeout float64
+	UnixSocket    string
+	QueryTimeout  float64
+	InverseAttrs  string
 }
 
 func parseFlags() options {
@@ -80,8 +98,12 @@ func parseFlags() options {
 	flag.UintVar(&o.Port, "port", 43, "port to listen")
 	flag.StringVar(&o.Address, "address", "*", "address to listen")
 	flag.StringVar(&o.Registry, "registry", ".", "path to dn42 registry")
+	flag.StringVar(&o.UnixSocket, "unix", "", "path to a unix domain socket to listen on, in addition to TCP")
 	msg := "timeout in seconds before suspending the service when using socket activation"
 	flag.Float64Var(&o.SocketTimeout, "timeout", 10, msg)
+	flag.Float64Var(&o.QueryTimeout, "query-timeout", 10, "timeout in seconds for reading a query and writing its response")
+	flag.StringVar(&o.InverseAttrs, "inverse-attrs", strings.Join(whois.DefaultInverseAttrs, ","),
+		"ATTR[,ATTR]... attributes that can be queried with -i")
 	flag.Parse()
 	if o.Address == "*" {
 		o.Address = ""
@@ -89,7 +111,7 @@ func parseFlags() options {
 	return o
 }
 
-func Listeners() []*net.TCPListener {
+func Listeners() []net.Listener {
 	defer os.Unsetenv("LISTEN_PID")
 	defer os.Unsetenv("LISTEN_FDS")
 
@@ -103,14 +125,12 @@ func Listeners() []*net.TCPListener {
 		return nil
 	}
 
-	listeners := make([]*net.TCPListener, 0)
+	listeners := make([]net.Listener, 0)
 	for fd := 3; fd < 3+nfds; fd++ {
 		syscall.CloseOnExec(fd)
 		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
 		if listener, err := net.FileListener(file); err == nil {
-			if l, ok := listener.(*net.TCPListener); ok {
-				listeners = append(listeners, l)
-			}
+			listeners = append(listeners, listener)
 		}
 	}
 
@@ -133,7 +153,12 @@ func createServer(opts options) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
-	server := New(dataPath)
+	queryTimeout := time.Duration(opts.QueryTimeout * float64(time.Second))
+	inverseAttrs := strings.Split(opts.InverseAttrs, ",")
+	server, err := New(dataPath, queryTimeout, inverseAttrs)
+	if err != nil {
+		return nil, err
+	}
 
 	if listeners := Listeners(); len(listeners) > 0 {
 		fmt.Printf("socket action detected\n")
@@ -147,7 +172,16 @@ func createServer(opts options) (*Server, error) {
 		if err != nil {
 			return nil, err
 		}
-		go server.Run(listener.(*net.TCPListener))
+		go server.Run(listener)
+
+		if opts.UnixSocket != "" {
+			os.Remove(opts.UnixSocket)
+			unixListener, err := net.Listen("unix", opts.UnixSocket)
+			if err != nil {
+				return nil, err
+			}
+			go server.Run(unixListener)
+		}
 	}
 	return server, nil
 }
@@ -38,6 +38,8 @@ type Flags struct {
 	ServerInfo string
 	TypeSchema string
 	Types      map[string]bool
+	Inverse    string
+	Format     string
 	Args       []string
 }
 
@@ -49,6 +51,8 @@ func parseFlags(request string) (*Flags, *flag.FlagSet, error) {
 	set.StringVar(&f.ServerInfo, "q", "", "[version|sources|types] query specified server info")
 	set.StringVar(&f.TypeSchema, "t", "", "request template for object of TYPE")
 	set.StringVar(&typeField, "T", "", "TYPE[,TYPE]... only look for objects of TYPE")
+	set.StringVar(&f.Inverse, "i", "", "ATTR find objects whose ATTR matches the given value(s)")
+	set.StringVar(&f.Format, "F", "", "[json] emit matched objects in the given format instead of raw RPSL")
 
 	if err := set.Parse(args); err != nil {
 		return nil, set, err
@@ -0,0 +1,187 @@
+package whois
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultInverseAttrs are the RPSL attributes InverseIndex keeps when the
+// server is not configured with -inverse-attrs.
+var DefaultInverseAttrs = []string{"mnt-by", "origin", "admin-c", "tech-c", "nserver", "member-of"}
+
+// InverseIndex is a background-maintained inverted index over RPSL
+// attribute values, letting "-i mnt-by FOO-MNT" style queries find every
+// object that references a value without scanning the registry on every
+// request. Only the attributes passed to NewInverseIndex are indexed.
+type InverseIndex struct {
+	mu       sync.RWMutex
+	index    map[string]map[string][]string // attr -> value -> object paths relative to dataPath
+	attrs    map[string]bool
+	dataPath string
+	watcher  *fsnotify.Watcher
+}
+
+// NewInverseIndex parses every object file under dataPath/* and builds an
+// inverted index over attrNames, then watches those directories to keep
+// the index up to date.
+func NewInverseIndex(dataPath string, attrNames []string) (*InverseIndex, error) {
+	attrs := make(map[string]bool, len(attrNames))
+	for _, a := range attrNames {
+		attrs[a] = true
+	}
+	idx := &InverseIndex{
+		index:    make(map[string]map[string][]string),
+		attrs:    attrs,
+		dataPath: dataPath,
+	}
+
+	dirs, err := idx.objectDirs()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err := idx.loadDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(path.Join(dataPath, dir)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	idx.watcher = watcher
+	go idx.watchEvents()
+
+	return idx, nil
+}
+
+func (idx *InverseIndex) objectDirs() ([]string, error) {
+	entries, err := ioutil.ReadDir(idx.dataPath)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	return dirs, nil
+}
+
+func (idx *InverseIndex) loadDir(dir string) error {
+	files, err := ioutil.ReadDir(path.Join(idx.dataPath, dir))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		idx.indexFile(path.Join(dir, f.Name()))
+	}
+	return nil
+}
+
+func (idx *InverseIndex) indexFile(rel string) {
+	f, err := os.Open(path.Join(idx.dataPath, rel))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	attrs, err := scanAttrs(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing '%s': %v\n", rel, err)
+		return
+	}
+	for _, a := range attrs {
+		name, value := a[0], a[1]
+		if !idx.attrs[name] {
+			continue
+		}
+		if idx.index[name] == nil {
+			idx.index[name] = make(map[string][]string)
+		}
+		idx.index[name][value] = append(idx.index[name][value], rel)
+	}
+}
+
+func (idx *InverseIndex) removeFile(rel string) {
+	for _, values := range idx.index {
+		for v, files := range values {
+			// Filter into a fresh backing array rather than reusing
+			// files[:0]. Lookup returns a copy taken under idx.mu, so
+			// callers never hold this slice itself.
+			kept := make([]string, 0, len(files))
+			for _, f := range files {
+				if f != rel {
+					kept = append(kept, f)
+				}
+			}
+			values[v] = kept
+		}
+	}
+}
+
+// Lookup returns a copy of every object path indexed under attr with the
+// given value, relative to the registry's DataPath. A copy is returned,
+// rather than the index's internal slice, so callers can range over the
+// result after releasing the lock without racing a concurrent update.
+func (idx *InverseIndex) Lookup(attr, value string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	files := idx.index[attr][value]
+	if len(files) == 0 {
+		return nil
+	}
+	out := make([]string, len(files))
+	copy(out, files)
+	return out
+}
+
+func (idx *InverseIndex) watchEvents() {
+	for {
+		select {
+		case event, ok := <-idx.watcher.Events:
+			if !ok {
+				return
+			}
+			idx.handleEvent(event)
+		case err, ok := <-idx.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Error watching registry: %v\n", err)
+		}
+	}
+}
+
+func (idx *InverseIndex) handleEvent(event fsnotify.Event) {
+	dir, file := path.Split(event.Name)
+	rel := path.Join(path.Base(path.Clean(dir)), file)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	switch {
+	case event.Op&(fsnotify.Create|fsnotify.Write) != 0:
+		idx.removeFile(rel)
+		idx.indexFile(rel)
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		idx.removeFile(rel)
+	}
+}
+
+// Close stops the underlying filesystem watcher.
+func (idx *InverseIndex) Close() error {
+	return idx.watcher.Close()
+}
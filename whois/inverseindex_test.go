@@ -0,0 +1,124 @@
+package whois
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func writeObject(t *testing.T, dir, typ, name, body string) {
+	if err := os.MkdirAll(path.Join(dir, typ), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := path.Join(dir, typ, name)
+	if err := ioutil.WriteFile(file, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInverseIndexLookup(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "whois-inverseindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	writeObject(t, tmp, "aut-num", "AS4242420001", "aut-num: AS4242420001\nmnt-by: FOO-MNT\n")
+	writeObject(t, tmp, "aut-num", "AS4242420002", "aut-num: AS4242420002\nmnt-by: FOO-MNT\n")
+	writeObject(t, tmp, "aut-num", "AS4242420003", "aut-num: AS4242420003\nmnt-by: BAR-MNT\n")
+
+	idx, err := NewInverseIndex(tmp, DefaultInverseAttrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	matches := idx.Lookup("mnt-by", "FOO-MNT")
+	sort.Strings(matches)
+	want := []string{"aut-num/AS4242420001", "aut-num/AS4242420002"}
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("Lookup() = %v, want %v", matches, want)
+	}
+
+	if matches := idx.Lookup("mnt-by", "BAR-MNT"); !reflect.DeepEqual(matches, []string{"aut-num/AS4242420003"}) {
+		t.Fatalf("Lookup() = %v, want [aut-num/AS4242420003]", matches)
+	}
+
+	if matches := idx.Lookup("mnt-by", "MISSING-MNT"); len(matches) != 0 {
+		t.Fatalf("Lookup() = %v, want no matches", matches)
+	}
+}
+
+func TestInverseIndexContinuationLines(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "whois-inverseindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	writeObject(t, tmp, "person", "JOHN-DN42", "person: John Doe\nremarks: line one\n  continued\nmnt-by: FOO-MNT\n")
+
+	idx, err := NewInverseIndex(tmp, DefaultInverseAttrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	if matches := idx.Lookup("mnt-by", "FOO-MNT"); !reflect.DeepEqual(matches, []string{"person/JOHN-DN42"}) {
+		t.Fatalf("Lookup() = %v, want [person/JOHN-DN42]", matches)
+	}
+}
+
+// TestInverseIndexConcurrentLookupAndUpdate exercises Lookup racing
+// removeFile/indexFile under fsnotify-driven updates. Run with -race: it
+// catches Lookup handing out a slice that a concurrent removeFile then
+// mutates in place.
+func TestInverseIndexConcurrentLookupAndUpdate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "whois-inverseindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	writeObject(t, tmp, "aut-num", "AS4242420001", "aut-num: AS4242420001\nmnt-by: FOO-MNT\n")
+
+	idx, err := NewInverseIndex(tmp, DefaultInverseAttrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, file := range idx.Lookup("mnt-by", "FOO-MNT") {
+				_ = len(file)
+			}
+		}
+	}()
+
+	other := path.Join(tmp, "aut-num", "AS4242420002")
+	for i := 0; i < 50; i++ {
+		writeObject(t, tmp, "aut-num", "AS4242420002", "aut-num: AS4242420002\nmnt-by: FOO-MNT\n")
+		waitFor(t, func() bool { return len(idx.Lookup("mnt-by", "FOO-MNT")) == 2 })
+		if err := os.Remove(other); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, func() bool { return len(idx.Lookup("mnt-by", "FOO-MNT")) == 1 })
+	}
+
+	close(stop)
+	wg.Wait()
+}
@@ -2,20 +2,55 @@ package whois
 
 import (
 	"bufio"
-	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"path"
 	"regexp"
-	"sort"
 	"strings"
+	"time"
 )
 
 type Registry struct {
-	DataPath string
+	DataPath     string
+	RouteIndex   *RouteIndex
+	InverseIndex *InverseIndex
+	QueryTimeout time.Duration
+}
+
+// NewRegistry builds a Registry backed by the dn42 registry data found at
+// dataPath, including the RouteIndex used to answer inetnum/route queries
+// and the InverseIndex used to answer "-i attr value" queries over
+// inverseAttrs. queryTimeout, if non-zero, bounds how long HandleQuery
+// waits to read a request and to write its response.
+func NewRegistry(dataPath string, queryTimeout time.Duration, inverseAttrs []string) (Registry, error) {
+	routeIndex, err := NewRouteIndex(dataPath)
+	if err != nil {
+		return Registry{}, err
+	}
+	inverseIndex, err := NewInverseIndex(dataPath, inverseAttrs)
+	if err != nil {
+		return Registry{}, err
+	}
+	return Registry{dataPath, routeIndex, inverseIndex, queryTimeout}, nil
+}
+
+// deadlineSetter is implemented by net.TCPConn, net.UnixConn and other
+// stream connections that support per-operation deadlines. HandleQuery
+// type-asserts for it so it can stay independent of the transport.
+type deadlineSetter interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// addresser is implemented by net.Conn. HandleQuery type-asserts for it
+// purely for logging, so it also works with a plain io.ReadWriter.
+type addresser interface {
+	RemoteAddr() net.Addr
 }
 
 type Type struct {
@@ -56,17 +91,17 @@ var whoisTypes = []Type{
 	{"as-block", regexp.MustCompile(`\d+_\d+`), UPPER},
 }
 
-func (r *Registry) handleObject(conn *net.TCPConn, object Object) bool {
+func (r *Registry) handleObject(rw io.ReadWriter, object Object, format string) bool {
 	found := false
 	for _, t := range whoisTypes {
 		if t.Kind == ROUTE || t.Kind == ROUTE6 {
 			if object[t.Kind] != nil {
-				found = found || r.printNet(conn, t.Name, object[t.Kind].(net.IP))
+				found = found || r.printNet(rw, t.Name, object[t.Kind].(net.IP), format)
 			}
 		} else {
 			arg := object[t.Kind].(string)
 			if t.Pattern.MatchString(arg) {
-				r.printObject(conn, t.Name, arg)
+				r.printObject(rw, t.Name, arg, format)
 				found = true
 			}
 		}
@@ -74,58 +109,66 @@ func (r *Registry) handleObject(conn *net.TCPConn, object Object) bool {
 	return found
 }
 
-func (r *Registry) HandleQuery(conn *net.TCPConn) {
-	fmt.Fprint(conn, "% This is the dn42 whois query service.\n\n")
+// HandleQuery answers a single whois request read from rw and writes the
+// response back to it. rw is an abstract io.ReadWriter so it works the
+// same whether it is backed by a TCP connection, a Unix domain socket, or
+// anything else that can read a request line and write a response; if rw
+// also supports per-operation deadlines, both a read deadline (for the
+// request line) and a write deadline (for the banner and the response)
+// are applied up front, so a client that never drains its receive buffer
+// can't pin a worker forever.
+func (r *Registry) HandleQuery(rw io.ReadWriter) {
+	if d, ok := rw.(deadlineSetter); ok && r.QueryTimeout > 0 {
+		deadline := time.Now().Add(r.QueryTimeout)
+		if err := d.SetReadDeadline(deadline); err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting read deadline: %v\n", err)
+		}
+		if err := d.SetWriteDeadline(deadline); err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting write deadline: %v\n", err)
+		}
+	}
+
+	fmt.Fprint(rw, "% This is the dn42 whois query service.\n\n")
 
-	query := parseQuery(conn)
+	query := r.parseQuery(rw)
 	if query == nil {
 		return
 	}
 
 	flags := query.Flags
 	if flags.ServerInfo != "" {
-		r.printServerInfo(conn, flags.ServerInfo)
+		r.printServerInfo(rw, flags.ServerInfo)
 		return
 	}
+
 	found := false
-	for _, obj := range query.Objects {
-		if r.handleObject(conn, obj) {
-			found = true
+	if flags.Inverse != "" {
+		found = r.handleInverse(rw, flags.Inverse, flags.Args, flags.Format)
+	} else {
+		for _, obj := range query.Objects {
+			if r.handleObject(rw, obj, flags.Format) {
+				found = true
+			}
 		}
 	}
 
 	if !found {
-		fmt.Fprint(conn, "% 404\n")
+		fmt.Fprint(rw, "% 404\n")
 	}
-	fmt.Fprint(conn, "\n")
+	fmt.Fprint(rw, "\n")
 }
 
-func readCidrs(path string) ([]net.IPNet, error) {
-	files, err := ioutil.ReadDir(path)
-	if err != nil {
-		return nil, err
-	}
-	cidrs := []net.IPNet{}
-	for _, f := range files {
-		name := strings.Replace(f.Name(), "_", "/", -1)
-		_, cidr, err := net.ParseCIDR(name)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "skip invalid net '%s'", f.Name())
-			continue
-		}
-		i := sort.Search(len(cidrs), func(i int) bool {
-			c := cidrs[i]
-			return bytes.Compare(c.Mask, cidr.Mask) >= 0
-		})
-
-		if i < len(cidrs) {
-			cidrs = append(cidrs[:i], append([]net.IPNet{*cidr}, cidrs[i:]...)...)
-		} else {
-			cidrs = append(cidrs, *cidr)
+// handleInverse resolves each value through the InverseIndex for attr and
+// prints every matching object file.
+func (r *Registry) handleInverse(rw io.ReadWriter, attr string, values []string, format string) bool {
+	found := false
+	for _, value := range values {
+		for _, file := range r.InverseIndex.Lookup(attr, strings.TrimSpace(value)) {
+			r.printFile(rw, file, format)
+			found = true
 		}
 	}
-
-	return cidrs, nil
+	return found
 }
 
 func parseObject(arg string) Object {
@@ -149,18 +192,18 @@ func parseObject(arg string) Object {
 	return object
 }
 
-func parseQuery(conn *net.TCPConn) *Query {
-	r := bufio.NewReader(conn)
-	req, e := r.ReadString('\n')
+func (r *Registry) parseQuery(rw io.ReadWriter) *Query {
+	br := bufio.NewReader(rw)
+	req, e := br.ReadString('\n')
 	if e != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", e)
 		return nil
 	}
 	flags, flagSet, err := parseFlags(req)
 	if err != nil {
-		flagSet.SetOutput(conn)
+		flagSet.SetOutput(rw)
 		if err != flag.ErrHelp {
-			fmt.Fprintf(conn, "%s", err)
+			fmt.Fprintf(rw, "%s", err)
 		}
 		flagSet.PrintDefaults()
 		return nil
@@ -172,45 +215,53 @@ func parseQuery(conn *net.TCPConn) *Query {
 	for i, arg := range flags.Args {
 		query.Objects[i] = parseObject(strings.TrimSpace(arg))
 	}
-	fmt.Fprintf(os.Stdout, "[%s] %s\n", conn.RemoteAddr(), req)
+	if a, ok := rw.(addresser); ok {
+		fmt.Fprintf(os.Stdout, "[%s] %s\n", a.RemoteAddr(), req)
+	} else {
+		fmt.Fprintf(os.Stdout, "%s\n", req)
+	}
 	return &query
 }
 
-func (r *Registry) printServerInfo(conn *net.TCPConn, what string) {
+func (r *Registry) printServerInfo(rw io.Writer, what string) {
 	switch what {
 	case "version":
-		fmt.Fprintf(conn, "%% whois42d v%d\n", VERSION)
+		fmt.Fprintf(rw, "%% whois42d v%d\n", VERSION)
 	case "sources":
-		fmt.Fprintf(conn, "DN42:3:N:0-0\n")
+		fmt.Fprintf(rw, "DN42:3:N:0-0\n")
 	case "types":
 		for _, t := range whoisTypes {
-			fmt.Fprintf(conn, "%s\n", t.Name)
+			fmt.Fprintf(rw, "%s\n", t.Name)
 		}
+		fmt.Fprintf(rw, "%% output formats: rpsl, json (-F json)\n")
 	default:
-		fmt.Fprintf(conn, "% unknown option %s\n", what)
+		fmt.Fprintf(rw, "% unknown option %s\n", what)
 	}
 }
 
-func (r *Registry) printNet(conn *net.TCPConn, name string, ip net.IP) bool {
-	routePath := path.Join(r.DataPath, name)
-	cidrs, err := readCidrs(routePath)
-	if err != nil {
-		fmt.Printf("Error reading cidr from '%s'\n", routePath)
-	}
-
+func (r *Registry) printNet(rw io.ReadWriter, name string, ip net.IP, format string) bool {
 	found := false
-	for _, c := range cidrs {
-		if c.Contains(ip) {
-			obj := strings.Replace(c.String(), "/", "_", -1)
-			r.printObject(conn, name, obj)
-			found = true
-		}
+	for _, obj := range r.RouteIndex.Lookup(name, ip) {
+		r.printObject(rw, name, obj, format)
+		found = true
 	}
 	return found
 }
 
-func (r *Registry) printObject(conn *net.TCPConn, objType string, obj string) {
-	file := path.Join(r.DataPath, objType, obj)
+func (r *Registry) printObject(w io.Writer, objType string, obj string, format string) {
+	r.printFile(w, path.Join(objType, obj), format)
+}
+
+// printFile writes the object file at DataPath/rel to w in the given
+// format ("" or "rpsl" for the raw RPSL text, "json" for a JSON
+// document).
+func (r *Registry) printFile(w io.Writer, rel string, format string) {
+	if format == "json" {
+		r.printFileJSON(w, rel)
+		return
+	}
+
+	file := path.Join(r.DataPath, rel)
 
 	f, err := os.Open(file)
 	defer f.Close()
@@ -221,7 +272,41 @@ func (r *Registry) printObject(conn *net.TCPConn, objType string, obj string) {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		return
 	}
-	fmt.Fprintf(conn, "%% Information related to '%s':\n", file[len(r.DataPath)+1:])
-	conn.ReadFrom(f)
-	fmt.Fprint(conn, "\n")
+	fmt.Fprintf(w, "%% Information related to '%s':\n", rel)
+	io.Copy(w, f)
+	fmt.Fprint(w, "\n")
+}
+
+// printFileJSON streams the object file at DataPath/rel to w as a single
+// NDJSON document. If the file can't be parsed as RPSL, the raw text is
+// returned alongside an "error" field instead.
+func (r *Registry) printFileJSON(w io.Writer, rel string) {
+	file := path.Join(r.DataPath, rel)
+
+	f, err := os.Open(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+		return
+	}
+	defer f.Close()
+
+	raw, err := ioutil.ReadAll(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return
+	}
+
+	obj, err := parseRPSL(objectType(rel), strings.NewReader(string(raw)))
+	enc := json.NewEncoder(w)
+	if err != nil {
+		enc.Encode(map[string]string{
+			"object-type": objectType(rel),
+			"error":       err.Error(),
+			"raw":         string(raw),
+		})
+		return
+	}
+	enc.Encode(obj)
 }
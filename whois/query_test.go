@@ -0,0 +1,51 @@
+package whois
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeConn drives HandleQuery the way a real connection would: Read
+// serves a fixed request line and Write accumulates the response.
+type fakeConn struct {
+	in  *strings.Reader
+	out bytes.Buffer
+}
+
+func (c *fakeConn) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
+
+func TestHandleQueryInverseTrimsTrailingNewline(t *testing.T) {
+	tmp := makeRegistryTree(t)
+	defer os.RemoveAll(tmp)
+
+	writeObject(t, tmp, "aut-num", "AS4242420001", "aut-num: AS4242420001\nmnt-by: FOO-MNT\n")
+	writeObject(t, tmp, "aut-num", "AS4242420002", "aut-num: AS4242420002\nmnt-by: FOO-MNT\n")
+
+	registry, err := NewRegistry(tmp, 0, DefaultInverseAttrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.RouteIndex.Close()
+	defer registry.InverseIndex.Close()
+
+	// Exactly what arrives over the wire: parseQuery reads up to and
+	// including the trailing newline from bufio.ReadString('\n').
+	conn := &fakeConn{in: strings.NewReader("-i mnt-by FOO-MNT\n")}
+	registry.HandleQuery(conn)
+
+	resp := conn.out.String()
+	if strings.Contains(resp, "% 404") {
+		t.Fatalf("HandleQuery() returned 404 for an indexed value:\n%s", resp)
+	}
+	if n := strings.Count(resp, "Information related to"); n != 2 {
+		t.Fatalf("HandleQuery() returned %d matches, want 2:\n%s", n, resp)
+	}
+}
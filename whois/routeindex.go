@@ -0,0 +1,224 @@
+package whois
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// trieNode is a node in a binary (bit-at-a-time) trie keyed on network
+// prefix bits. A node holds a filename whenever a CIDR registered in the
+// index ends exactly at that node.
+type trieNode struct {
+	children [2]*trieNode
+	file     string
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{}
+}
+
+func (n *trieNode) insert(bits []byte, file string) {
+	cur := n
+	for _, b := range bits {
+		if cur.children[b] == nil {
+			cur.children[b] = newTrieNode()
+		}
+		cur = cur.children[b]
+	}
+	cur.file = file
+}
+
+func (n *trieNode) remove(bits []byte) {
+	cur := n
+	for _, b := range bits {
+		if cur.children[b] == nil {
+			return
+		}
+		cur = cur.children[b]
+	}
+	cur.file = ""
+}
+
+// lookup walks bits from the root and returns every registered filename
+// along the path, most-specific (deepest) match first.
+func (n *trieNode) lookup(bits []byte) []string {
+	matches := []string{}
+	cur := n
+	if cur.file != "" {
+		matches = append(matches, cur.file)
+	}
+	for _, b := range bits {
+		if cur.children[b] == nil {
+			break
+		}
+		cur = cur.children[b]
+		if cur.file != "" {
+			matches = append(matches, cur.file)
+		}
+	}
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// addrBits expands an IP address into a slice of its individual bits,
+// most significant bit first.
+func addrBits(ip net.IP) []byte {
+	raw := ip.To4()
+	if raw == nil {
+		raw = ip.To16()
+	}
+	bits := make([]byte, len(raw)*8)
+	for i, b := range raw {
+		for j := 0; j < 8; j++ {
+			if b&(1<<uint(7-j)) != 0 {
+				bits[i*8+j] = 1
+			}
+		}
+	}
+	return bits
+}
+
+func ipNetBits(n *net.IPNet) []byte {
+	ones, _ := n.Mask.Size()
+	return addrBits(n.IP)[:ones]
+}
+
+func cidrFromFilename(name string) (*net.IPNet, error) {
+	_, cidr, err := net.ParseCIDR(strings.Replace(name, "_", "/", -1))
+	return cidr, err
+}
+
+// routeDirs are the object types that RouteIndex keeps a trie for, each
+// backed by its own directory under DataPath.
+var routeDirs = []string{"inetnum", "inet6num", "route", "route6"}
+
+// RouteIndex keeps a longest-prefix-match trie per route-like object type
+// (inetnum, inet6num, route, route6), rebuilt in memory from the files on
+// disk at startup and kept up to date via fsnotify so lookups never have
+// to touch the filesystem.
+type RouteIndex struct {
+	mu       sync.RWMutex
+	tries    map[string]*trieNode
+	dataPath string
+	watcher  *fsnotify.Watcher
+}
+
+// NewRouteIndex walks DataPath/{inetnum,inet6num,route,route6}, builds a
+// trie for each, and starts watching the four directories for changes.
+func NewRouteIndex(dataPath string) (*RouteIndex, error) {
+	idx := &RouteIndex{
+		tries:    make(map[string]*trieNode, len(routeDirs)),
+		dataPath: dataPath,
+	}
+	for _, name := range routeDirs {
+		idx.tries[name] = newTrieNode()
+		if err := idx.loadDir(name); err != nil {
+			return nil, err
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range routeDirs {
+		if err := watcher.Add(path.Join(dataPath, name)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	idx.watcher = watcher
+	go idx.watchEvents()
+
+	return idx, nil
+}
+
+func (idx *RouteIndex) loadDir(name string) error {
+	dir := path.Join(idx.dataPath, name)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	root := idx.tries[name]
+	for _, f := range files {
+		idx.insertFile(root, f.Name())
+	}
+	return nil
+}
+
+func (idx *RouteIndex) insertFile(root *trieNode, filename string) {
+	cidr, err := cidrFromFilename(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "skip invalid net '%s'\n", filename)
+		return
+	}
+	root.insert(ipNetBits(cidr), filename)
+}
+
+// Lookup returns the filenames of every CIDR registered under dir that
+// contains ip, most-specific match first.
+func (idx *RouteIndex) Lookup(dir string, ip net.IP) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	root, ok := idx.tries[dir]
+	if !ok {
+		return nil
+	}
+	return root.lookup(addrBits(ip))
+}
+
+func (idx *RouteIndex) watchEvents() {
+	for {
+		select {
+		case event, ok := <-idx.watcher.Events:
+			if !ok {
+				return
+			}
+			idx.handleEvent(event)
+		case err, ok := <-idx.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Error watching registry: %v\n", err)
+		}
+	}
+}
+
+func (idx *RouteIndex) handleEvent(event fsnotify.Event) {
+	dir, file := path.Split(event.Name)
+	name := path.Base(path.Clean(dir))
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	root, ok := idx.tries[name]
+	if !ok {
+		return
+	}
+
+	switch {
+	case event.Op&(fsnotify.Create|fsnotify.Write) != 0:
+		idx.insertFile(root, file)
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		cidr, err := cidrFromFilename(file)
+		if err != nil {
+			return
+		}
+		root.remove(ipNetBits(cidr))
+	}
+}
+
+// Close stops the underlying filesystem watcher.
+func (idx *RouteIndex) Close() error {
+	return idx.watcher.Close()
+}
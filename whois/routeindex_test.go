@@ -0,0 +1,100 @@
+package whois
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeRegistryTree(t *testing.T) string {
+	tmp, err := ioutil.TempDir("", "whois-routeindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range routeDirs {
+		if err := os.MkdirAll(path.Join(tmp, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tmp
+}
+
+func writeRoute(t *testing.T, dir, typ, cidr string) {
+	name := strings.Replace(cidr, "/", "_", -1)
+	file := path.Join(dir, typ, name)
+	if err := ioutil.WriteFile(file, []byte(cidr+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRouteIndexLongestPrefixMatch(t *testing.T) {
+	tmp := makeRegistryTree(t)
+	defer os.RemoveAll(tmp)
+
+	writeRoute(t, tmp, "route", "10.0.0.0/8")
+	writeRoute(t, tmp, "route", "10.1.0.0/16")
+
+	idx, err := NewRouteIndex(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	matches := idx.Lookup("route", net.ParseIP("10.1.2.3"))
+	want := []string{"10.1.0.0_16", "10.0.0.0_8"}
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("Lookup() = %v, want %v", matches, want)
+	}
+
+	if matches := idx.Lookup("route", net.ParseIP("10.2.0.1")); !reflect.DeepEqual(matches, []string{"10.0.0.0_8"}) {
+		t.Fatalf("Lookup() = %v, want [10.0.0.0_8]", matches)
+	}
+
+	if matches := idx.Lookup("route", net.ParseIP("192.168.0.1")); len(matches) != 0 {
+		t.Fatalf("Lookup() = %v, want no matches", matches)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met before deadline")
+}
+
+func TestRouteIndexLiveUpdate(t *testing.T) {
+	tmp := makeRegistryTree(t)
+	defer os.RemoveAll(tmp)
+
+	idx, err := NewRouteIndex(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	ip := net.ParseIP("172.16.5.1")
+	if matches := idx.Lookup("inetnum", ip); len(matches) != 0 {
+		t.Fatalf("expected no matches before file creation, got %v", matches)
+	}
+
+	writeRoute(t, tmp, "inetnum", "172.16.0.0/12")
+	waitFor(t, func() bool {
+		return len(idx.Lookup("inetnum", ip)) == 1
+	})
+
+	if err := os.Remove(path.Join(tmp, "inetnum", "172.16.0.0_12")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		return len(idx.Lookup("inetnum", ip)) == 0
+	})
+}
@@ -0,0 +1,81 @@
+package whois
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Attribute is a single RPSL "name: value" pair, in the order it appeared
+// in the object file.
+type Attribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// RPSLObject is an RPSL object turned into an ordered attribute list, the
+// representation used for the "-F json" output mode.
+type RPSLObject struct {
+	ObjectType string      `json:"object-type"`
+	PrimaryKey string      `json:"primary-key"`
+	Attributes []Attribute `json:"attributes"`
+}
+
+// parseRPSL reads an RPSL object of the given type from r. The object's
+// primary key is taken to be the value of its first attribute, which is
+// how RPSL identifies an object (e.g. the "AS4242420000" in
+// "aut-num: AS4242420000").
+func parseRPSL(objectType string, r io.Reader) (*RPSLObject, error) {
+	pairs, err := scanAttrs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &RPSLObject{
+		ObjectType: objectType,
+		Attributes: make([]Attribute, len(pairs)),
+	}
+	for i, p := range pairs {
+		obj.Attributes[i] = Attribute{Name: p[0], Value: p[1]}
+	}
+	if len(obj.Attributes) > 0 {
+		obj.PrimaryKey = obj.Attributes[0].Value
+	}
+	return obj, nil
+}
+
+// objectType returns the directory component of an object path relative
+// to DataPath, e.g. "aut-num" for "aut-num/AS4242420000".
+func objectType(rel string) string {
+	if i := strings.IndexByte(rel, '/'); i >= 0 {
+		return rel[:i]
+	}
+	return rel
+}
+
+// scanAttrs reads RPSL key/value pairs from r in file order, joining
+// continuation lines (lines starting with whitespace or '+') onto the
+// value of the preceding attribute.
+func scanAttrs(r io.Reader) ([][2]string, error) {
+	scanner := bufio.NewScanner(r)
+	attrs := [][2]string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if len(attrs) > 0 && (line[0] == ' ' || line[0] == '\t' || line[0] == '+') {
+			last := &attrs[len(attrs)-1]
+			last[1] = strings.TrimSpace(last[1] + " " + strings.TrimPrefix(strings.TrimSpace(line), "+"))
+			continue
+		}
+		sep := strings.IndexByte(line, ':')
+		if sep < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:sep]))
+		value := strings.TrimSpace(line[sep+1:])
+		attrs = append(attrs, [2]string{name, value})
+	}
+	return attrs, scanner.Err()
+}
@@ -0,0 +1,38 @@
+package whois
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRPSL(t *testing.T) {
+	text := "aut-num: AS4242420000\nremarks: line one\n  continued\nmnt-by: FOO-MNT\n"
+
+	obj, err := parseRPSL("aut-num", strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &RPSLObject{
+		ObjectType: "aut-num",
+		PrimaryKey: "AS4242420000",
+		Attributes: []Attribute{
+			{Name: "aut-num", Value: "AS4242420000"},
+			{Name: "remarks", Value: "line one continued"},
+			{Name: "mnt-by", Value: "FOO-MNT"},
+		},
+	}
+	if !reflect.DeepEqual(obj, want) {
+		t.Fatalf("parseRPSL() = %+v, want %+v", obj, want)
+	}
+}
+
+func TestObjectType(t *testing.T) {
+	if got := objectType("aut-num/AS4242420000"); got != "aut-num" {
+		t.Fatalf("objectType() = %q, want %q", got, "aut-num")
+	}
+	if got := objectType("AS4242420000"); got != "AS4242420000" {
+		t.Fatalf("objectType() = %q, want %q", got, "AS4242420000")
+	}
+}